@@ -0,0 +1,114 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+// This file depends on github.com/hashicorp/go-multierror and
+// golang.org/x/time/rate. This tree is a source snapshot with no go.mod,
+// so there is no manifest here to add them to; wire them in alongside the
+// rest of this package's dependencies when vendoring into a real module.
+import (
+	"context"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+// defaultDeleteConcurrency is used when Options.DeleteConcurrency is unset.
+const defaultDeleteConcurrency = 8
+
+var deleteTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "boskos_aws_delete_total",
+	Help: "Count of AWS resource deletion attempts, by resource type and result.",
+}, []string{"resource", "result"})
+
+func init() {
+	prometheus.MustRegister(deleteTotal)
+}
+
+// deleteJob is a unit of work submitted to runDeletePool. throttle must be
+// called by the job immediately before each individual EC2 API call it
+// makes (not just once at job start), so that a job issuing several calls
+// -- e.g. a force-detach's DetachVolume, its DescribeVolumes polls, and the
+// final DeleteVolume -- can't burst past Options.DeleteQPS.
+type deleteJob func(throttle func()) error
+
+// runDeletePool fans deletes out across a bounded pool of workers, rate
+// limited via Options.DeleteQPS to stay under EC2 API throttling limits,
+// and aggregates per-resource failures into a single error so the caller
+// can report how many of the deletions failed instead of just logging and
+// swallowing them one at a time.
+func runDeletePool(resource string, opts Options, jobs []deleteJob) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	concurrency := opts.DeleteConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultDeleteConcurrency
+	}
+	if concurrency > len(jobs) {
+		concurrency = len(jobs)
+	}
+
+	var limiter *rate.Limiter
+	if opts.DeleteQPS > 0 {
+		limiter = rate.NewLimiter(rate.Limit(opts.DeleteQPS), concurrency)
+	}
+	throttle := func() {
+		if limiter != nil {
+			_ = limiter.Wait(context.Background())
+		}
+	}
+
+	// Buffered so the submission loop below can hand off all jobs without
+	// waiting for a worker to be free to receive each one.
+	toDelete := make(chan deleteJob, len(jobs))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var result *multierror.Error
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range toDelete {
+				label := "success"
+				if err := job(throttle); err != nil {
+					label = "error"
+					mu.Lock()
+					result = multierror.Append(result, err)
+					mu.Unlock()
+				}
+				deleteTotal.WithLabelValues(resource, label).Inc()
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		toDelete <- job
+	}
+	close(toDelete)
+	wg.Wait()
+
+	if result != nil {
+		return errors.Wrapf(result.ErrorOrNil(), "%d of %d %s deletions failed", len(result.Errors), len(jobs), resource)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"strings"
+	"time"
+)
+
+// TagMatcher matches a resource's tags against a key/value pattern, used to
+// configure Options.PreserveTags. Value may end in a single trailing "*" to
+// match by prefix (e.g. Key: "Name", Value: "golden-dev-*"); an empty Value
+// matches any value for Key.
+type TagMatcher struct {
+	Key   string
+	Value string
+}
+
+// Matches reports whether tags satisfy the pattern.
+func (m TagMatcher) Matches(tags map[string]string) bool {
+	v, ok := tags[m.Key]
+	if !ok {
+		return false
+	}
+	if m.Value == "" {
+		return true
+	}
+	if strings.HasSuffix(m.Value, "*") {
+		return strings.HasPrefix(v, strings.TrimSuffix(m.Value, "*"))
+	}
+	return v == m.Value
+}
+
+// preserved reports whether tags match any of opts.PreserveTags, in which
+// case the resource should be skipped by both marking and deletion.
+//
+// A trash-lifetime backup snapshot (TrashBackupTagKey) is exempted only
+// until its own TrashBackupExpiresAtTagKey elapses; once that longer,
+// separate retention window is up, this stops protecting it and a later
+// Snapshots sweep marks and deletes it the same as any other snapshot, so
+// backups don't accumulate forever.
+func preserved(opts Options, tags map[string]string) bool {
+	if tags[TrashBackupTagKey] == "true" {
+		expiresAt, ok := tags[TrashBackupExpiresAtTagKey]
+		if !ok {
+			// No expiry recorded: treat conservatively and preserve
+			// rather than risk deleting an undated backup.
+			return true
+		}
+		at, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil || time.Now().Before(at) {
+			return true
+		}
+	}
+	for _, m := range opts.PreserveTags {
+		if m.Matches(tags) {
+			return true
+		}
+	}
+	return false
+}
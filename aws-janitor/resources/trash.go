@@ -0,0 +1,105 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// TrashAtTagKey records the time at which a quarantined resource becomes
+// eligible for actual deletion.
+const TrashAtTagKey = "boskos.k8s.io/trash-at"
+
+// TrashBackupTagKey marks a snapshot as the final backup taken by
+// trashOrDelete before a volume's trash lifetime begins.
+const TrashBackupTagKey = "boskos.k8s.io/trash-backup"
+
+// TrashBackupExpiresAtTagKey records when a trash-lifetime backup
+// snapshot's own, longer retention ends. Until then, preserved() exempts
+// the backup from the Snapshots sweep; once it elapses, the tag no longer
+// protects it and the backup is marked and deleted like any other
+// snapshot on a subsequent Snapshots sweep (see preserved in preserve.go).
+// This keeps the backup around well past its source volume's own trash
+// lifetime without exempting it from cost control forever.
+const TrashBackupExpiresAtTagKey = "boskos.k8s.io/trash-backup-expires-at"
+
+// TrashBackupRetention is how long a trash-lifetime backup snapshot is
+// protected for, deliberately longer than a typical TrashLifetime so the
+// backup outlives the volume it was taken from.
+const TrashBackupRetention = 30 * 24 * time.Hour
+
+// trashBackupTags returns the tags trashOrDelete's snapshotBeforeDelete
+// callback should apply to a backup snapshot so it's protected for
+// TrashBackupRetention and then reclaimed by the normal Snapshots sweep.
+func trashBackupTags() []*ec2.Tag {
+	return []*ec2.Tag{
+		{Key: aws.String(TrashBackupTagKey), Value: aws.String("true")},
+		{Key: aws.String(TrashBackupExpiresAtTagKey), Value: aws.String(time.Now().Add(TrashBackupRetention).Format(time.RFC3339))},
+	}
+}
+
+// trashOrDelete implements the two-phase "trash lifetime" pattern for EC2
+// sweepers (Volumes.MarkAndSweep calls it; Snapshots.MarkAndSweep does not
+// and deletes directly): the first sweep that would delete a resource instead
+// tags it with a future TrashAtTagKey timestamp, and only once that time
+// has passed does a later sweep report it as safe to delete. Leaving
+// opts.TrashLifetime at its zero value, or setting opts.UnsafeDelete,
+// bypasses quarantine and preserves immediate-delete behavior.
+//
+// snapshotBeforeDelete, if non-nil, is invoked the first time the resource
+// is quarantined (when opts.SnapshotBeforeDelete is set) so callers can
+// take a final backup before the trash lifetime begins.
+func trashOrDelete(svc *ec2.EC2, logger *logrus.Entry, opts Options, id string, tags map[string]string, snapshotBeforeDelete func() error) (deleteNow bool, err error) {
+	if opts.UnsafeDelete || opts.TrashLifetime == 0 {
+		return true, nil
+	}
+
+	if trashAt, ok := tags[TrashAtTagKey]; ok {
+		at, parseErr := time.Parse(time.RFC3339, trashAt)
+		if parseErr != nil {
+			logger.Warningf("%s: invalid %s tag %q, re-quarantining: %v", id, TrashAtTagKey, trashAt, parseErr)
+		} else {
+			return !time.Now().Before(at), nil
+		}
+	}
+
+	if opts.DryRun {
+		// Dry runs must be side-effect-free: report that this resource
+		// would be quarantined without actually tagging it or taking the
+		// pre-trash backup snapshot.
+		logger.Warningf("%s: would tag for a %s trash lifetime", id, opts.TrashLifetime)
+		return false, nil
+	}
+
+	if opts.SnapshotBeforeDelete && snapshotBeforeDelete != nil {
+		if err := snapshotBeforeDelete(); err != nil {
+			logger.Warningf("%s: snapshot before trash failed: %v", id, err)
+		}
+	}
+
+	trashAt := time.Now().Add(opts.TrashLifetime).Format(time.RFC3339)
+	_, err = svc.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{aws.String(id)},
+		Tags:      []*ec2.Tag{{Key: aws.String(TrashAtTagKey), Value: aws.String(trashAt)}},
+	})
+	return false, errors.Wrapf(err, "%s: failed to tag for trash lifetime", id)
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// NameTagKey is the AWS tag holding a resource's human-readable name.
+const NameTagKey = "Name"
+
+// Options holds the configuration shared by every resource sweeper: which
+// account/region/session to operate against, and the safety knobs
+// sweepers consult before mutating anything.
+type Options struct {
+	Session *session.Session
+	Account string
+	Region  string
+	DryRun  bool
+
+	// DefaultTTL is how long a resource may go unmarked before it becomes
+	// eligible for deletion, absent a more specific per-resource TTL.
+	DefaultTTL time.Duration
+
+	// ForceDetachVolumes, if set, allows Volumes.MarkAndSweep to forcibly
+	// detach an attached volume, once it was first seen at least
+	// ForceDetachAfter ago, before deleting it. defaultForceDetachAfter (see
+	// volumes.go) applies when ForceDetachAfter is left at its zero value,
+	// so enabling ForceDetachVolumes without also setting a threshold still
+	// requires the volume to have been first seen at least that long ago.
+	ForceDetachVolumes bool
+	ForceDetachAfter   time.Duration
+
+	// TrashLifetime, if nonzero, quarantines an eligible-for-deletion
+	// resource by tagging it with a future trash-at time instead of
+	// deleting it immediately, giving operators a recovery window. Zero
+	// preserves immediate-delete behavior. See trashOrDelete.
+	TrashLifetime time.Duration
+	// SnapshotBeforeDelete, combined with TrashLifetime, takes a backup
+	// snapshot of a volume the first time it's quarantined.
+	SnapshotBeforeDelete bool
+	// UnsafeDelete bypasses the TrashLifetime quarantine entirely.
+	UnsafeDelete bool
+
+	// DeleteConcurrency is the size of the worker pool sweepers use to
+	// delete resources concurrently. Zero uses defaultDeleteConcurrency for
+	// every sweeper.
+	DeleteConcurrency int
+	// DeleteQPS rate-limits every EC2 API call a delete job makes, to stay
+	// under EC2 API throttling limits. Zero disables rate limiting.
+	DeleteQPS float64
+
+	// PreserveTags exempts any resource whose tags match one of these
+	// patterns from both marking and deletion, regardless of TTL. See
+	// preserved in preserve.go.
+	PreserveTags []TagMatcher
+}
+
+// Interface is implemented by every resource type this janitor knows how
+// to list and clean up.
+type Interface interface {
+	MarkAndSweep(opts Options, set *Set) error
+	ListAll(opts Options) (*Set, error)
+}
+
+// keyedResource is anything a Set can track by a stable identifier.
+type keyedResource interface {
+	ResourceKey() string
+}
+
+// Set tracks, across runs, how long each resource has been observed so
+// MarkAndSweep can tell whether a resource has aged past its TTL.
+type Set struct {
+	ttl       time.Duration
+	firstSeen map[string]time.Time
+	marked    map[string]time.Time
+}
+
+// NewSet creates an empty Set with the given default TTL.
+func NewSet(ttl time.Duration) *Set {
+	return &Set{
+		ttl:       ttl,
+		firstSeen: make(map[string]time.Time),
+		marked:    make(map[string]time.Time),
+	}
+}
+
+// Mark records that r was observed this run and reports whether it has
+// now been marked for at least the Set's TTL, i.e. whether it's eligible
+// for a sweeper to act on.
+func (s *Set) Mark(opts Options, r keyedResource, createdAt *time.Time, tags map[string]string) bool {
+	key := r.ResourceKey()
+	now := time.Now()
+
+	if _, ok := s.firstSeen[key]; !ok {
+		s.firstSeen[key] = now
+	}
+	if _, ok := s.marked[key]; !ok {
+		s.marked[key] = now
+	}
+
+	ttl := s.ttl
+	if ttl == 0 {
+		ttl = opts.DefaultTTL
+	}
+
+	return now.Sub(s.marked[key]) >= ttl
+}
+
+// fromEC2Tags converts EC2's tag representation into a plain map.
+func fromEC2Tags(tags []*ec2.Tag) map[string]string {
+	out := make(map[string]string, len(tags))
+	for _, t := range tags {
+		if t.Key != nil && t.Value != nil {
+			out[*t.Key] = *t.Value
+		}
+	}
+	return out
+}
@@ -29,28 +29,80 @@ import (
 // Volumes: https://docs.aws.amazon.com/sdk-for-go/api/service/ec2/#EC2.DescribeVolumes
 type Volumes struct{}
 
+// pendingVolumeDelete is a volume queued for deletion once the paged scan
+// completes, along with whether it needs a force-detach immediately before
+// that delete.
+type pendingVolumeDelete struct {
+	vol         *volume
+	forceDetach bool
+}
+
 func (Volumes) MarkAndSweep(opts Options, set *Set) error {
 	logger := logrus.WithField("options", opts)
 	svc := ec2.New(opts.Session, aws.NewConfig().WithRegion(opts.Region))
 
-	var toDelete []*volume // Paged call, defer deletion until we have the whole list.
+	var toDelete []pendingVolumeDelete // Paged call, defer deletion until we have the whole list.
 
 	pageFunc := func(page *ec2.DescribeVolumesOutput, _ bool) bool {
 		for _, vol := range page.Volumes {
 			v := &volume{Account: opts.Account, Region: opts.Region, ID: *vol.VolumeId}
 			tags := fromEC2Tags(vol.Tags)
+			if preserved(opts, tags) {
+				continue
+			}
 			if !set.Mark(opts, v, vol.CreateTime, tags) {
 				continue
 			}
 			// Since tags and other metadata may not propagate to volumes from their attachments,
 			// we avoid deleting any volume that is currently attached. Once their attached resource is deleted,
 			// we can safely delete volumes in a later clean-up run (using the mark data we saved in this run).
+			// The exception is opts.ForceDetachVolumes: an attached volume past the force-detach threshold
+			// is force-detached and then deleted.
+			forceDetach := false
 			if len(vol.Attachments) > 0 {
+				if !opts.ForceDetachVolumes {
+					continue
+				}
+				threshold := opts.ForceDetachAfter
+				if threshold <= 0 {
+					// An operator who enables ForceDetachVolumes but
+					// leaves ForceDetachAfter unset still gets a minimum
+					// age, measured from when the volume was first seen.
+					threshold = defaultForceDetachAfter
+				}
+				firstSeen, ok := set.firstSeen[v.ARN()]
+				if !ok || time.Since(firstSeen) < threshold {
+					continue
+				}
+				// Only record the need to force-detach here; the detach
+				// itself is destructive and can take tens of seconds to
+				// poll to completion, so it's deferred into the delete
+				// worker pool below rather than run inline in this page
+				// callback, and only happens if we actually go on to
+				// delete the volume (not merely quarantine it).
+				forceDetach = true
+			}
+			deleteNow, err := trashOrDelete(svc, logger, opts, v.ID, tags, func() error {
+				_, err := svc.CreateSnapshot(&ec2.CreateSnapshotInput{
+					VolumeId:    aws.String(v.ID),
+					Description: aws.String(fmt.Sprintf("boskos trash-lifetime backup of %s", v.ID)),
+					TagSpecifications: []*ec2.TagSpecification{{
+						ResourceType: aws.String(ec2.ResourceTypeSnapshot),
+						Tags:         trashBackupTags(),
+					}},
+				})
+				return err
+			})
+			if err != nil {
+				logger.Warningf("%s: %v", v.ARN(), err)
+			}
+			if !deleteNow {
 				continue
 			}
+
 			logger.Warningf("%s: deleting %T: %s (%s)", v.ARN(), vol, v.ID, tags[NameTagKey])
 			if !opts.DryRun {
-				toDelete = append(toDelete, v)
+				toDelete = append(toDelete, pendingVolumeDelete{vol: v, forceDetach: forceDetach})
 			}
 		}
 		return true
@@ -60,17 +112,66 @@ func (Volumes) MarkAndSweep(opts Options, set *Set) error {
 		return err
 	}
 
-	for _, vol := range toDelete {
-		deleteReq := &ec2.DeleteVolumeInput{
-			VolumeId: aws.String(vol.ID),
-		}
+	jobs := make([]deleteJob, 0, len(toDelete))
+	for _, pending := range toDelete {
+		pending := pending
+		jobs = append(jobs, func(throttle func()) error {
+			if pending.forceDetach {
+				if err := forceDetachVolume(svc, logger, pending.vol, throttle); err != nil {
+					return errors.Wrapf(err, "%s: force detach failed", pending.vol.ARN())
+				}
+			}
+			throttle()
+			_, err := svc.DeleteVolume(&ec2.DeleteVolumeInput{VolumeId: aws.String(pending.vol.ID)})
+			return errors.Wrapf(err, "%s: delete failed", pending.vol.ARN())
+		})
+	}
+
+	return runDeletePool("volume", opts, jobs)
+}
 
-		if _, err := svc.DeleteVolume(deleteReq); err != nil {
-			logger.Warningf("%s: delete failed: %v", vol.ARN(), err)
+// forceDetachMaxAttempts bounds how long we'll poll DescribeVolumes for a
+// force-detached volume to reach the "available" state before giving up.
+const forceDetachMaxAttempts = 5
+
+// defaultForceDetachAfter applies when Options.ForceDetachVolumes is set
+// but Options.ForceDetachAfter is left at its zero value.
+const defaultForceDetachAfter = time.Hour
+
+// forceDetachVolume detaches v with Force set (overriding any in-guest
+// unmount) and waits, with exponential backoff, for it to transition to
+// "available" so the caller can safely delete it. It only runs once we're
+// actually about to delete v (opts.DryRun is false and the trash lifetime,
+// if any, has elapsed) so a dry run or a quarantined volume is never
+// touched. throttle is called before every EC2 API call this makes (the
+// detach itself and each poll) so a force-detach, which can issue several
+// calls, can't burst past Options.DeleteQPS on its own.
+func forceDetachVolume(svc *ec2.EC2, logger *logrus.Entry, v *volume, throttle func()) error {
+	logger.Warningf("%s: force-detaching after exceeding ForceDetachAfter threshold", v.ARN())
+	throttle()
+	if _, err := svc.DetachVolume(&ec2.DetachVolumeInput{
+		VolumeId: aws.String(v.ID),
+		Force:    aws.Bool(true),
+	}); err != nil {
+		return errors.Wrapf(err, "force detach of %s failed", v.ID)
+	}
+
+	backoff := time.Second
+	for i := 0; i < forceDetachMaxAttempts; i++ {
+		time.Sleep(backoff)
+		backoff *= 2
+
+		throttle()
+		out, err := svc.DescribeVolumes(&ec2.DescribeVolumesInput{VolumeIds: []*string{aws.String(v.ID)}})
+		if err != nil {
+			return errors.Wrapf(err, "describe volumes for %s failed", v.ID)
+		}
+		if len(out.Volumes) == 0 || aws.StringValue(out.Volumes[0].State) == ec2.VolumeStateAvailable {
+			return nil
 		}
 	}
 
-	return nil
+	return errors.Errorf("%s: timed out waiting for volume to become available after force detach", v.ID)
 }
 
 func (Volumes) ListAll(opts Options) (*Set, error) {